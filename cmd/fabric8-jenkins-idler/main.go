@@ -1,14 +1,20 @@
 package main
 
 import (
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"context"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/cluster"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/metrics"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/ratelimit"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/tenant"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/toggles"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/token"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/transport/sshtunnel"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/version"
 	log "github.com/sirupsen/logrus"
 )
@@ -41,6 +47,11 @@ func main() {
 	config := createAndValidateConfiguration()
 	mainLogger.Infof("Idler configuration: %s", config.String())
 
+	// Cancel the root context on SIGTERM/SIGINT so Idler.Run can drain every
+	// UserIdler cleanly instead of dying mid-flight.
+	ctx, cancel := context.WithCancel(context.Background())
+	installSignalHandler(cancel)
+
 	// Get OSIO service account token from Auth
 	osioToken := osioToken(config)
 
@@ -51,11 +62,86 @@ func main() {
 	// Create Toggle (Unleash) Service
 	featuresService := createFeatureToggle(config)
 
-	// Create Tenant Service
-	tenantService := tenant.NewTenantService(config.GetTenantURL(), osioToken)
+	// tunnels is shared by every URL this process tunnels - the tenant service
+	// below, and every UserIdler's OpenShift API and proxy URLs - so that all
+	// traffic to the same cluster reuses one dialed tunnel instead of each
+	// caller dialing its own.
+	tunnels := sshtunnel.NewPool()
+
+	// Create Tenant Service. When clusters aren't directly reachable (private
+	// networks, on-prem tenants), route through an SSH tunnel instead.
+	tenantURL, err := tunnels.Rewrite(ctx, sshTunnelConfig(config), config.GetTenantURL())
+	if err != nil {
+		mainLogger.WithField("err", err).Fatal("Unable to reach tenant service")
+	}
+	tenantService := tenant.NewTenantService(tenantURL, osioToken)
+
+	// Create the metrics recorder and expose it for scraping
+	recorder := createMetricsRecorder(config)
+	serveMetrics(config, recorder)
+
+	// Rate limit OpenShift API calls, keyed per cluster, to avoid thundering
+	// herds when many namespaces flap at once.
+	limiter := ratelimit.New(config.GetRateLimiterMaxCalls(), config.GetRateLimiterPer(), config.GetRateLimiterMaxConsecutiveErrors(), recorder)
+
+	idler := NewIdler(featuresService, tenantService, clusterView, config, recorder, limiter, tunnels)
+	idler.Run(ctx)
+
+	// recorder is a single instance shared by every UserIdler, so it is
+	// flushed here, once, after Run's top-level WaitGroup confirms every
+	// UserIdler has shut down - not from inside each UserIdler's own
+	// shutdown, which would tear it down out from under the others.
+	if err := recorder.Flush(); err != nil {
+		mainLogger.WithField("err", err).Warn("Error flushing metrics.")
+	}
+}
+
+// sshTunnelConfig builds the sshtunnel.Config for the tenant service's
+// Rewrite call. idler.NewUserIdler builds the same Config from config itself
+// for the per-user OpenShift API and proxy URLs.
+func sshTunnelConfig(config configuration.Configuration) sshtunnel.Config {
+	return sshtunnel.Config{
+		Enabled:    config.GetSSHTunnelEnabled(),
+		Addr:       config.GetSSHTunnelAddr(),
+		User:       config.GetSSHTunnelUser(),
+		PrivateKey: config.GetSSHTunnelPrivateKey(),
+		HostKey:    config.GetSSHTunnelHostKey(),
+	}
+}
+
+// installSignalHandler cancels ctx as soon as the process receives SIGTERM
+// or SIGINT, so in-flight idle/unidle operations get a chance to finish
+// before the idler exits.
+func installSignalHandler(cancel context.CancelFunc) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigCh
+		mainLogger.WithField("signal", sig.String()).Info("termination signal received, shutting down")
+		cancel()
+	}()
+}
 
-	idler := NewIdler(featuresService, tenantService, clusterView, config)
-	idler.Run()
+func createMetricsRecorder(config configuration.Configuration) metrics.Recorder {
+	recorder, err := metrics.NewRecorder(config)
+	if err != nil {
+		// Fatal with exit program
+		mainLogger.WithField("err", err).Fatal("Unable to create metrics recorder")
+	}
+	return recorder
+}
+
+func serveMetrics(config configuration.Configuration, recorder metrics.Recorder) {
+	handler := recorder.Handler()
+	if handler == nil {
+		return
+	}
+	http.Handle("/metrics", handler)
+	go func() {
+		if err := http.ListenAndServe(config.GetMetricsAddress(), nil); err != nil {
+			mainLogger.WithField("err", err).Error("Metrics server stopped")
+		}
+	}()
 }
 
 func createAndValidateConfiguration() configuration.Configuration {
@@ -0,0 +1,303 @@
+// Package configuration loads and validates the idler's runtime settings
+// from environment variables (prefixed JC_), with sane defaults so the
+// idler runs locally without a full environment.
+package configuration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const envPrefix = "JC"
+
+// Variable names, relative to envPrefix, for every setting the idler reads.
+const (
+	varAuthURL      = "auth.url"
+	varAuthTokenKey = "auth.token.key"
+	varTenantURL    = "tenant.url"
+	varToggleURL    = "toggle.url"
+	varFixedUUIDs   = "fixed.uuids"
+	varIdleAfter    = "idle.after"
+	varProxyURL     = "proxy.url"
+
+	varRateLimiterMaxCalls             = "ratelimiter.max.calls"
+	varRateLimiterPer                  = "ratelimiter.per"
+	varRateLimiterMaxConsecutiveErrors = "ratelimiter.max.consecutive.errors"
+
+	varMetricsExporter = "metrics.exporter"
+	varMetricsAddress  = "metrics.address"
+	varStatsdAddress   = "statsd.address"
+
+	varPipelineRequeueBackoff = "pipeline.requeue.backoff"
+
+	varBackoffBase           = "backoff.base"
+	varBackoffCap            = "backoff.cap"
+	varBackoffJitter         = "backoff.jitter"
+	varBackoffMaxElapsedTime = "backoff.max.elapsed.time"
+
+	varSSHTunnelEnabled    = "ssh.tunnel.enabled"
+	varSSHTunnelAddr       = "ssh.tunnel.addr"
+	varSSHTunnelUser       = "ssh.tunnel.user"
+	varSSHTunnelPrivateKey = "ssh.tunnel.private.key"
+	varSSHTunnelHostKey    = "ssh.tunnel.host.key"
+)
+
+// Configuration is the settings surface used across the idler: cluster and
+// auth lookups, feature toggles, per-user idle behaviour and the OpenShift
+// rate limiter.
+type Configuration interface {
+	// GetAuthURL returns the URL of the auth service used to resolve tokens.
+	GetAuthURL() string
+	// GetAuthTokenKey returns the PGP key used to decrypt cluster tokens
+	// obtained from the auth service.
+	GetAuthTokenKey() string
+	// GetTenantURL returns the URL of the tenant service.
+	GetTenantURL() string
+	// GetToggleURL returns the URL of the Unleash feature toggle service.
+	GetToggleURL() string
+	// GetFixedUuids returns a fixed list of user UUIDs to enable the idler
+	// for, bypassing the toggle service. Empty unless explicitly configured.
+	GetFixedUuids() []string
+	// GetIdleAfter returns, in minutes, how long a Jenkins instance must be
+	// inactive before it is idled.
+	GetIdleAfter() int
+	// GetProxyURL returns the URL of the OpenShift proxy used for the
+	// "user" idle condition. Empty disables that condition.
+	GetProxyURL() string
+
+	// GetRateLimiterMaxCalls returns the number of OpenShift API calls
+	// allowed per GetRateLimiterPer, per cluster bucket.
+	GetRateLimiterMaxCalls() int
+	// GetRateLimiterPer returns the time window GetRateLimiterMaxCalls is
+	// measured over.
+	GetRateLimiterPer() time.Duration
+	// GetRateLimiterMaxConsecutiveErrors returns after how many consecutive
+	// refusals from a rate limiter bucket Wait returns an error instead of
+	// continuing to retry.
+	GetRateLimiterMaxConsecutiveErrors() int
+
+	// GetMetricsExporter returns which metrics.Recorder backend to use, one
+	// of metrics.ExporterPrometheus or metrics.ExporterStatsd.
+	GetMetricsExporter() string
+	// GetMetricsAddress returns the address the Prometheus /metrics endpoint
+	// listens on.
+	GetMetricsAddress() string
+	// GetStatsdAddress returns the address of the statsd collector to send
+	// metrics to, when GetMetricsExporter is metrics.ExporterStatsd.
+	GetStatsdAddress() string
+
+	// GetPipelineRequeueBackoff returns how long a UserIdler waits before
+	// putting its user back on its own channel after a pipeline Requeue.
+	GetPipelineRequeueBackoff() time.Duration
+
+	// GetBackoffBase returns the starting delay for UserIdler's checkIdle
+	// backoff, doubled on every consecutive failure.
+	GetBackoffBase() time.Duration
+	// GetBackoffCap returns the upper bound the checkIdle backoff delay
+	// never exceeds, before jitter is added.
+	GetBackoffCap() time.Duration
+	// GetBackoffJitter returns the upper bound of the random jitter added to
+	// every checkIdle backoff delay.
+	GetBackoffJitter() time.Duration
+	// GetBackoffMaxElapsedTime returns how long a UserIdler may keep failing
+	// checkIdle before it logs a warning about it; it keeps retrying at the
+	// capped delay rather than giving up. Zero disables the warning.
+	GetBackoffMaxElapsedTime() time.Duration
+
+	// GetSSHTunnelEnabled returns whether OpenShift/Jenkins/tenant URLs should
+	// be routed through an SSH tunnel, for clusters not directly reachable
+	// from wherever the idler runs.
+	GetSSHTunnelEnabled() bool
+	// GetSSHTunnelAddr returns the jump host to dial, e.g. "bastion:22", when
+	// GetSSHTunnelEnabled is true.
+	GetSSHTunnelAddr() string
+	// GetSSHTunnelUser returns the SSH user to authenticate as.
+	GetSSHTunnelUser() string
+	// GetSSHTunnelPrivateKey returns a PEM-encoded private key authenticating
+	// GetSSHTunnelUser.
+	GetSSHTunnelPrivateKey() string
+	// GetSSHTunnelHostKey returns the expected host key of GetSSHTunnelAddr,
+	// in authorized_keys format.
+	GetSSHTunnelHostKey() string
+
+	// Verify checks that every required setting has a usable value.
+	Verify() ValidationErrors
+	// String returns the current settings, for startup logging.
+	String() string
+}
+
+// ValidationErrors collects the problems found by Verify.
+type ValidationErrors struct {
+	Errors []error
+}
+
+// Empty reports whether any validation errors were collected.
+func (e ValidationErrors) Empty() bool {
+	return len(e.Errors) == 0
+}
+
+// ToError joins the collected errors into a single error, or nil if there
+// were none.
+func (e ValidationErrors) ToError() error {
+	if e.Empty() {
+		return nil
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Errorf(strings.Join(msgs, "; "))
+}
+
+// ConfigurationData is the viper-backed implementation of Configuration.
+type ConfigurationData struct {
+	v *viper.Viper
+}
+
+// NewConfiguration creates a Configuration that reads JC_-prefixed
+// environment variables, falling back to the defaults set in setDefaults.
+func NewConfiguration() (Configuration, error) {
+	v := viper.New()
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	c := &ConfigurationData{v: v}
+	c.setDefaults()
+	return c, nil
+}
+
+func (c *ConfigurationData) setDefaults() {
+	c.v.SetDefault(varIdleAfter, 30)
+
+	c.v.SetDefault(varRateLimiterMaxCalls, 10)
+	c.v.SetDefault(varRateLimiterPer, time.Second)
+	c.v.SetDefault(varRateLimiterMaxConsecutiveErrors, 5)
+
+	c.v.SetDefault(varMetricsExporter, "prometheus")
+	c.v.SetDefault(varMetricsAddress, ":9100")
+
+	c.v.SetDefault(varPipelineRequeueBackoff, 5*time.Second)
+
+	c.v.SetDefault(varBackoffBase, time.Second)
+	c.v.SetDefault(varBackoffCap, 5*time.Minute)
+	c.v.SetDefault(varBackoffJitter, time.Second)
+	c.v.SetDefault(varBackoffMaxElapsedTime, 15*time.Minute)
+
+	c.v.SetDefault(varSSHTunnelEnabled, false)
+}
+
+func (c *ConfigurationData) GetAuthURL() string {
+	return c.v.GetString(varAuthURL)
+}
+
+func (c *ConfigurationData) GetAuthTokenKey() string {
+	return c.v.GetString(varAuthTokenKey)
+}
+
+func (c *ConfigurationData) GetTenantURL() string {
+	return c.v.GetString(varTenantURL)
+}
+
+func (c *ConfigurationData) GetToggleURL() string {
+	return c.v.GetString(varToggleURL)
+}
+
+func (c *ConfigurationData) GetFixedUuids() []string {
+	return c.v.GetStringSlice(varFixedUUIDs)
+}
+
+func (c *ConfigurationData) GetIdleAfter() int {
+	return c.v.GetInt(varIdleAfter)
+}
+
+func (c *ConfigurationData) GetProxyURL() string {
+	return c.v.GetString(varProxyURL)
+}
+
+func (c *ConfigurationData) GetRateLimiterMaxCalls() int {
+	return c.v.GetInt(varRateLimiterMaxCalls)
+}
+
+func (c *ConfigurationData) GetRateLimiterPer() time.Duration {
+	return c.v.GetDuration(varRateLimiterPer)
+}
+
+func (c *ConfigurationData) GetRateLimiterMaxConsecutiveErrors() int {
+	return c.v.GetInt(varRateLimiterMaxConsecutiveErrors)
+}
+
+func (c *ConfigurationData) GetMetricsExporter() string {
+	return c.v.GetString(varMetricsExporter)
+}
+
+func (c *ConfigurationData) GetMetricsAddress() string {
+	return c.v.GetString(varMetricsAddress)
+}
+
+func (c *ConfigurationData) GetStatsdAddress() string {
+	return c.v.GetString(varStatsdAddress)
+}
+
+func (c *ConfigurationData) GetPipelineRequeueBackoff() time.Duration {
+	return c.v.GetDuration(varPipelineRequeueBackoff)
+}
+
+func (c *ConfigurationData) GetBackoffBase() time.Duration {
+	return c.v.GetDuration(varBackoffBase)
+}
+
+func (c *ConfigurationData) GetBackoffCap() time.Duration {
+	return c.v.GetDuration(varBackoffCap)
+}
+
+func (c *ConfigurationData) GetBackoffJitter() time.Duration {
+	return c.v.GetDuration(varBackoffJitter)
+}
+
+func (c *ConfigurationData) GetBackoffMaxElapsedTime() time.Duration {
+	return c.v.GetDuration(varBackoffMaxElapsedTime)
+}
+
+func (c *ConfigurationData) GetSSHTunnelEnabled() bool {
+	return c.v.GetBool(varSSHTunnelEnabled)
+}
+
+func (c *ConfigurationData) GetSSHTunnelAddr() string {
+	return c.v.GetString(varSSHTunnelAddr)
+}
+
+func (c *ConfigurationData) GetSSHTunnelUser() string {
+	return c.v.GetString(varSSHTunnelUser)
+}
+
+func (c *ConfigurationData) GetSSHTunnelPrivateKey() string {
+	return c.v.GetString(varSSHTunnelPrivateKey)
+}
+
+func (c *ConfigurationData) GetSSHTunnelHostKey() string {
+	return c.v.GetString(varSSHTunnelHostKey)
+}
+
+// Verify checks that every required setting has a usable value.
+func (c *ConfigurationData) Verify() ValidationErrors {
+	var errs ValidationErrors
+	if c.GetAuthURL() == "" {
+		errs.Errors = append(errs.Errors, fmt.Errorf("%s_AUTH_URL must be set", envPrefix))
+	}
+	if c.GetTenantURL() == "" {
+		errs.Errors = append(errs.Errors, fmt.Errorf("%s_TENANT_URL must be set", envPrefix))
+	}
+	if c.GetToggleURL() == "" && len(c.GetFixedUuids()) == 0 {
+		errs.Errors = append(errs.Errors, fmt.Errorf("%s_TOGGLE_URL must be set unless %s_FIXED_UUIDS is", envPrefix, envPrefix))
+	}
+	return errs
+}
+
+// String returns the current settings, for startup logging.
+func (c *ConfigurationData) String() string {
+	return fmt.Sprintf("%+v", c.v.AllSettings())
+}
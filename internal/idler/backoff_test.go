@@ -0,0 +1,72 @@
+package idler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/configuration"
+	log "github.com/sirupsen/logrus"
+)
+
+func newTestUserIdler(t *testing.T) *UserIdler {
+	t.Helper()
+	config, err := configuration.NewConfiguration()
+	if err != nil {
+		t.Fatalf("NewConfiguration() error = %v", err)
+	}
+	return &UserIdler{
+		config: config,
+		logger: log.NewEntry(log.New()),
+	}
+}
+
+func TestBackoffDelayGrowsExponentiallyUpToCap(t *testing.T) {
+	idler := newTestUserIdler(t)
+	base := idler.config.GetBackoffBase()
+	capped := idler.config.GetBackoffCap()
+	jitter := idler.config.GetBackoffJitter()
+
+	var prevMin time.Duration
+	for i := 0; i < 10; i++ {
+		delay := idler.backoffDelay()
+		want := base << uint(i)
+		if want <= 0 || want > capped {
+			want = capped
+		}
+		if delay < want || delay > want+jitter {
+			t.Fatalf("attempt %d: delay = %v, want in [%v, %v]", i, delay, want, want+jitter)
+		}
+		if delay < prevMin {
+			t.Fatalf("attempt %d: delay %v shrank below previous minimum %v", i, delay, prevMin)
+		}
+		prevMin = want
+	}
+}
+
+func TestBackoffDelayNeverExceedsCapPlusJitter(t *testing.T) {
+	idler := newTestUserIdler(t)
+	capped := idler.config.GetBackoffCap()
+	jitter := idler.config.GetBackoffJitter()
+
+	for i := 0; i < 64; i++ {
+		if delay := idler.backoffDelay(); delay > capped+jitter {
+			t.Fatalf("attempt %d: delay = %v, want <= cap+jitter = %v", i, delay, capped+jitter)
+		}
+	}
+}
+
+func TestResetBackoffRestartsTheStreak(t *testing.T) {
+	idler := newTestUserIdler(t)
+	base := idler.config.GetBackoffBase()
+	jitter := idler.config.GetBackoffJitter()
+
+	idler.backoffDelay()
+	idler.backoffDelay()
+	idler.backoffDelay()
+	idler.resetBackoff()
+
+	delay := idler.backoffDelay()
+	if delay < base || delay > base+jitter {
+		t.Fatalf("delay after reset = %v, want in [%v, %v]", delay, base, base+jitter)
+	}
+}
@@ -0,0 +1,87 @@
+// Package pipeline runs the idle/unidle flow as a sequence of small, testable
+// steps instead of one monolithic function. It is modeled on the multistep
+// runner pattern: each Step can let the run Continue, Halt it (unwinding
+// already-run steps via Cleanup), or Requeue the whole run for a later
+// attempt. This lets operators insert cluster-specific steps (drain builds,
+// notify webhooks, verify scale-down) without forking UserIdler.
+package pipeline
+
+import "context"
+
+// StepAction tells the Runner what to do after a Step returns.
+type StepAction int
+
+const (
+	// Continue moves on to the next Step.
+	Continue StepAction = iota
+	// Halt stops the run and unwinds every executed Step via Cleanup.
+	Halt
+	// Requeue stops the run without unwinding; the caller is expected to
+	// retry the whole pipeline later, typically after a backoff.
+	Requeue
+)
+
+// StateBag carries values between Steps and from the caller into the first
+// Step, keyed by the well-known constants declared alongside each Step that
+// reads or writes them.
+type StateBag map[string]interface{}
+
+// NewStateBag creates an empty StateBag.
+func NewStateBag() StateBag {
+	return make(StateBag)
+}
+
+// Get returns the value stored under key, or nil if it isn't set.
+func (b StateBag) Get(key string) interface{} {
+	return b[key]
+}
+
+// Put stores value under key.
+func (b StateBag) Put(key string, value interface{}) {
+	b[key] = value
+}
+
+// Step is a single unit of work in an idle/unidle pipeline.
+type Step interface {
+	// Run performs the step's work and reports what the Runner should do next.
+	Run(ctx context.Context, state StateBag) StepAction
+	// Cleanup reverses the step's effects. It is only called, in reverse
+	// execution order, when this step or a later step in the same run
+	// returns Halt.
+	Cleanup(state StateBag)
+}
+
+// Runner executes a fixed sequence of Steps against a single StateBag.
+type Runner struct {
+	Steps []Step
+}
+
+// NewRunner creates a Runner for the given Steps, executed in order.
+func NewRunner(steps ...Step) *Runner {
+	return &Runner{Steps: steps}
+}
+
+// Run executes every Step in order until one returns a StepAction other than
+// Continue. On Halt, every already-executed Step is cleaned up in reverse
+// order. Run returns the final StepAction, which the caller uses to decide
+// whether to retry the whole pipeline (Requeue) or stop (Halt/Continue).
+func (r *Runner) Run(ctx context.Context, state StateBag) StepAction {
+	executed := make([]Step, 0, len(r.Steps))
+	action := Continue
+
+	for _, step := range r.Steps {
+		executed = append(executed, step)
+		action = step.Run(ctx, state)
+		if action != Continue {
+			break
+		}
+	}
+
+	if action == Halt {
+		for i := len(executed) - 1; i >= 0; i-- {
+			executed[i].Cleanup(state)
+		}
+	}
+
+	return action
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+)
+
+// recordingStep appends its name to a shared log on Run and Cleanup, and
+// returns a fixed StepAction, so tests can assert both the Runner's result
+// and which steps ran/were cleaned up, in what order.
+type recordingStep struct {
+	name   string
+	action StepAction
+	log    *[]string
+}
+
+func (s *recordingStep) Run(ctx context.Context, state StateBag) StepAction {
+	*s.log = append(*s.log, "run:"+s.name)
+	return s.action
+}
+
+func (s *recordingStep) Cleanup(state StateBag) {
+	*s.log = append(*s.log, "cleanup:"+s.name)
+}
+
+func TestRunnerContinuesThroughAllSteps(t *testing.T) {
+	var log []string
+	runner := NewRunner(
+		&recordingStep{name: "a", action: Continue, log: &log},
+		&recordingStep{name: "b", action: Continue, log: &log},
+	)
+
+	if action := runner.Run(context.Background(), NewStateBag()); action != Continue {
+		t.Fatalf("Run() = %v, want Continue", action)
+	}
+
+	want := []string{"run:a", "run:b"}
+	if !equal(log, want) {
+		t.Fatalf("log = %v, want %v", log, want)
+	}
+}
+
+func TestRunnerHaltUnwindsExecutedStepsInReverseOrder(t *testing.T) {
+	var log []string
+	runner := NewRunner(
+		&recordingStep{name: "a", action: Continue, log: &log},
+		&recordingStep{name: "b", action: Halt, log: &log},
+		&recordingStep{name: "c", action: Continue, log: &log},
+	)
+
+	if action := runner.Run(context.Background(), NewStateBag()); action != Halt {
+		t.Fatalf("Run() = %v, want Halt", action)
+	}
+
+	// "c" never ran, since "b" halted the run, so it is neither run nor
+	// cleaned up. "a" and "b" are cleaned up in reverse execution order.
+	want := []string{"run:a", "run:b", "cleanup:b", "cleanup:a"}
+	if !equal(log, want) {
+		t.Fatalf("log = %v, want %v", log, want)
+	}
+}
+
+func TestRunnerRequeueDoesNotUnwind(t *testing.T) {
+	var log []string
+	runner := NewRunner(
+		&recordingStep{name: "a", action: Continue, log: &log},
+		&recordingStep{name: "b", action: Requeue, log: &log},
+		&recordingStep{name: "c", action: Continue, log: &log},
+	)
+
+	if action := runner.Run(context.Background(), NewStateBag()); action != Requeue {
+		t.Fatalf("Run() = %v, want Requeue", action)
+	}
+
+	// Requeue does not unwind: no Cleanup calls are made for the steps that
+	// already ran.
+	want := []string{"run:a", "run:b"}
+	if !equal(log, want) {
+		t.Fatalf("log = %v, want %v", log, want)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/metrics"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/model"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/openshift/client"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/ratelimit"
+	log "github.com/sirupsen/logrus"
+)
+
+// Well-known StateBag keys shared by the default steps and their caller.
+// The caller (UserIdler) populates the "in" keys before running the
+// pipeline; steps populate the "out" keys for later steps to consume.
+const (
+	KeyLogger          = "logger"          // in:  *log.Entry
+	KeyOpenShiftClient = "openShiftClient" // in:  client.OpenShiftClient
+	KeyLimiter         = "limiter"         // in:  ratelimit.Limiter
+	KeyMetrics         = "metrics"         // in:  metrics.Recorder
+	KeyOpenShiftAPI    = "openShiftAPI"    // in:  string
+	KeyBearerToken     = "bearerToken"     // in:  string
+	KeyNamespace       = "namespace"       // in:  string
+	KeyJenkinsState    = "jenkinsState"    // out: int (model.Jenkins*)
+	KeyActionTaken     = "actionTaken"     // out: bool, set once idling/un-idling is actually attempted
+	KeyError           = "error"           // out: error
+)
+
+func stateLogger(state StateBag) *log.Entry {
+	return state.Get(KeyLogger).(*log.Entry)
+}
+
+func stateClient(state StateBag) client.OpenShiftClient {
+	return state.Get(KeyOpenShiftClient).(client.OpenShiftClient)
+}
+
+func stateLimiter(state StateBag) ratelimit.Limiter {
+	return state.Get(KeyLimiter).(ratelimit.Limiter)
+}
+
+func stateMetrics(state StateBag) metrics.Recorder {
+	return state.Get(KeyMetrics).(metrics.Recorder)
+}
+
+// FetchJenkinsStateStep looks up the current idle state of the Jenkins
+// service and stores it under KeyJenkinsState.
+type FetchJenkinsStateStep struct{}
+
+func (s *FetchJenkinsStateStep) Run(ctx context.Context, state StateBag) StepAction {
+	if err := stateLimiter(state).Wait(ctx, state.Get(KeyOpenShiftAPI).(string)); err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+
+	done := metrics.TimeOpenShiftCall(stateMetrics(state), metrics.OpIsIdle)
+	jenkinsState, err := stateClient(state).IsIdle(
+		state.Get(KeyOpenShiftAPI).(string),
+		state.Get(KeyBearerToken).(string),
+		state.Get(KeyNamespace).(string),
+		"jenkins",
+	)
+	done()
+	if err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+
+	state.Put(KeyJenkinsState, jenkinsState)
+	return Continue
+}
+
+func (s *FetchJenkinsStateStep) Cleanup(state StateBag) {}
+
+// IncrementAttemptsStep conditionally bumps the idle/un-idle attempt counter
+// once FetchJenkinsStateStep has determined whether any action is needed,
+// and records that decision under KeyActionTaken for the verify steps.
+type IncrementAttemptsStep struct {
+	// Increment bumps the caller's attempt counter, e.g. UserIdler.incrementIdleAttempts.
+	Increment func()
+	// NeedsAction reports whether jenkinsState requires idling/un-idling.
+	NeedsAction func(jenkinsState int) bool
+}
+
+func (s *IncrementAttemptsStep) Run(ctx context.Context, state StateBag) StepAction {
+	needsAction := s.NeedsAction(state.Get(KeyJenkinsState).(int))
+	state.Put(KeyActionTaken, needsAction)
+	if needsAction {
+		s.Increment()
+	}
+	return Continue
+}
+
+func (s *IncrementAttemptsStep) Cleanup(state StateBag) {}
+
+// IdleServiceStep idles a single named service. The default idle pipeline
+// has one of these per entry in idler.JenkinsServices.
+type IdleServiceStep struct {
+	ServiceName string
+}
+
+func (s *IdleServiceStep) Run(ctx context.Context, state StateBag) StepAction {
+	jenkinsState := state.Get(KeyJenkinsState).(int)
+	if jenkinsState <= model.JenkinsIdled {
+		return Continue
+	}
+
+	if err := stateLimiter(state).Wait(ctx, state.Get(KeyOpenShiftAPI).(string)); err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+
+	stateLogger(state).Info("About to idle " + s.ServiceName)
+	done := metrics.TimeOpenShiftCall(stateMetrics(state), metrics.OpIdle)
+	err := stateClient(state).Idle(
+		state.Get(KeyOpenShiftAPI).(string),
+		state.Get(KeyBearerToken).(string),
+		state.Get(KeyNamespace).(string),
+		s.ServiceName,
+	)
+	done()
+	if err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+	return Continue
+}
+
+func (s *IdleServiceStep) Cleanup(state StateBag) {}
+
+// UnidleServiceStep un-idles a single named service. The default un-idle
+// pipeline has one of these per entry in idler.JenkinsServices.
+type UnidleServiceStep struct {
+	ServiceName string
+}
+
+func (s *UnidleServiceStep) Run(ctx context.Context, state StateBag) StepAction {
+	jenkinsState := state.Get(KeyJenkinsState).(int)
+	if jenkinsState != model.JenkinsIdled {
+		return Continue
+	}
+
+	if err := stateLimiter(state).Wait(ctx, state.Get(KeyOpenShiftAPI).(string)); err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+
+	stateLogger(state).Info("About to un-idle " + s.ServiceName)
+	done := metrics.TimeOpenShiftCall(stateMetrics(state), metrics.OpUnIdle)
+	err := stateClient(state).UnIdle(
+		state.Get(KeyOpenShiftAPI).(string),
+		state.Get(KeyBearerToken).(string),
+		state.Get(KeyNamespace).(string),
+		s.ServiceName,
+	)
+	done()
+	if err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+	return Continue
+}
+
+func (s *UnidleServiceStep) Cleanup(state StateBag) {}
+
+// VerifyIdledStep re-checks the Jenkins state after idling to confirm the
+// service actually went idle, requeuing the whole run if it didn't.
+type VerifyIdledStep struct{}
+
+func (s *VerifyIdledStep) Run(ctx context.Context, state StateBag) StepAction {
+	return verifyState(ctx, state, model.JenkinsIdled, func(jenkinsState, want int) bool {
+		return jenkinsState == want
+	})
+}
+
+func (s *VerifyIdledStep) Cleanup(state StateBag) {}
+
+// VerifyUnidledStep re-checks the Jenkins state after un-idling to confirm
+// the service actually came back up, requeuing the whole run if it didn't.
+type VerifyUnidledStep struct{}
+
+func (s *VerifyUnidledStep) Run(ctx context.Context, state StateBag) StepAction {
+	return verifyState(ctx, state, model.JenkinsIdled, func(jenkinsState, want int) bool {
+		return jenkinsState > want
+	})
+}
+
+func (s *VerifyUnidledStep) Cleanup(state StateBag) {}
+
+func verifyState(ctx context.Context, state StateBag, want int, satisfied func(jenkinsState, want int) bool) StepAction {
+	if taken, _ := state.Get(KeyActionTaken).(bool); !taken {
+		// Nothing was idled/un-idled this round, so the state already
+		// fetched by FetchJenkinsStateStep is still accurate.
+		return Continue
+	}
+
+	if err := stateLimiter(state).Wait(ctx, state.Get(KeyOpenShiftAPI).(string)); err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+
+	done := metrics.TimeOpenShiftCall(stateMetrics(state), metrics.OpIsIdle)
+	jenkinsState, err := stateClient(state).IsIdle(
+		state.Get(KeyOpenShiftAPI).(string),
+		state.Get(KeyBearerToken).(string),
+		state.Get(KeyNamespace).(string),
+		"jenkins",
+	)
+	done()
+	if err != nil {
+		state.Put(KeyError, err)
+		return Requeue
+	}
+
+	if !satisfied(jenkinsState, want) {
+		state.Put(KeyError, fmt.Errorf("jenkins did not reach the expected state, got %d", jenkinsState))
+		return Requeue
+	}
+
+	state.Put(KeyJenkinsState, jenkinsState)
+	return Continue
+}
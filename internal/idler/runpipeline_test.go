@@ -0,0 +1,101 @@
+package idler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/idler/pipeline"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/metrics"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// fixedActionStep always returns action and marks KeyActionTaken, so tests
+// can drive runPipeline through every outcome without a real OpenShift call.
+type fixedActionStep struct {
+	action      pipeline.StepAction
+	actionTaken bool
+}
+
+func (s *fixedActionStep) Run(ctx context.Context, state pipeline.StateBag) pipeline.StepAction {
+	state.Put(pipeline.KeyActionTaken, s.actionTaken)
+	return s.action
+}
+
+func (s *fixedActionStep) Cleanup(state pipeline.StateBag) {}
+
+// countingRecorder is a metrics.Recorder stub that only tracks which results
+// IdleAttempt was called with, for asserting runPipeline's result recording.
+type countingRecorder struct {
+	results []string
+}
+
+func (r *countingRecorder) IdleAttempt(result string)                           { r.results = append(r.results, result) }
+func (r *countingRecorder) UnidleAttempt(result string)                         {}
+func (r *countingRecorder) ConditionEval(condition string, result string)       {}
+func (r *countingRecorder) OpenShiftCall(op string, duration time.Duration)     {}
+func (r *countingRecorder) CheckIdle(duration time.Duration)                    {}
+func (r *countingRecorder) IncActiveUserIdlers()                                {}
+func (r *countingRecorder) DecActiveUserIdlers()                                {}
+func (r *countingRecorder) SetIdleAttempts(user string, n int)                  {}
+func (r *countingRecorder) SetUnidleAttempts(user string, n int)                {}
+func (r *countingRecorder) SetRateLimiterQueueDepth(bucket string, depth int64) {}
+func (r *countingRecorder) Handler() http.Handler                               { return nil }
+func (r *countingRecorder) Flush() error                                        { return nil }
+
+func newRunPipelineTestUserIdler(t *testing.T, rec metrics.Recorder) *UserIdler {
+	t.Helper()
+	idler := newTestUserIdler(t)
+	idler.logger = log.NewEntry(log.New())
+	idler.metrics = rec
+	idler.userChan = make(chan model.User, 1)
+	return idler
+}
+
+func TestRunPipelineRecordsErrorWhenActionTakenAndStepsRequeue(t *testing.T) {
+	rec := &countingRecorder{}
+	idler := newRunPipelineTestUserIdler(t, rec)
+
+	runner := pipeline.NewRunner(&fixedActionStep{action: pipeline.Requeue, actionTaken: true})
+	state := pipeline.NewStateBag()
+
+	if err := idler.runPipeline(context.Background(), runner, state, model.User{ID: "u1"}, metrics.Recorder.IdleAttempt); err != nil {
+		t.Fatalf("runPipeline() error = %v, want nil (fixedActionStep sets no KeyError)", err)
+	}
+
+	if len(rec.results) != 1 || rec.results[0] != metrics.ResultError {
+		t.Fatalf("IdleAttempt calls = %v, want [%q]", rec.results, metrics.ResultError)
+	}
+}
+
+func TestRunPipelineRecordsNothingWhenNoActionWasTaken(t *testing.T) {
+	rec := &countingRecorder{}
+	idler := newRunPipelineTestUserIdler(t, rec)
+
+	runner := pipeline.NewRunner(&fixedActionStep{action: pipeline.Requeue, actionTaken: false})
+	state := pipeline.NewStateBag()
+
+	idler.runPipeline(context.Background(), runner, state, model.User{ID: "u1"}, metrics.Recorder.IdleAttempt)
+
+	if len(rec.results) != 0 {
+		t.Fatalf("IdleAttempt calls = %v, want none when KeyActionTaken is false", rec.results)
+	}
+}
+
+func TestRunPipelineRecordsSuccessWhenActionTakenAndStepsContinue(t *testing.T) {
+	rec := &countingRecorder{}
+	idler := newRunPipelineTestUserIdler(t, rec)
+
+	runner := pipeline.NewRunner(&fixedActionStep{action: pipeline.Continue, actionTaken: true})
+	state := pipeline.NewStateBag()
+
+	if err := idler.runPipeline(context.Background(), runner, state, model.User{ID: "u1"}, metrics.Recorder.IdleAttempt); err != nil {
+		t.Fatalf("runPipeline() error = %v, want nil", err)
+	}
+
+	if len(rec.results) != 1 || rec.results[0] != metrics.ResultSuccess {
+		t.Fatalf("IdleAttempt calls = %v, want [%q]", rec.results, metrics.ResultSuccess)
+	}
+}
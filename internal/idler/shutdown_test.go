@@ -0,0 +1,40 @@
+package idler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type noopTenantService struct{}
+
+func (noopTenantService) Deregister(id string) error { return nil }
+
+func TestShutdownReturnsOnceShutdownTimeoutElapsesWithAnOperationStillInFlight(t *testing.T) {
+	idler := &UserIdler{
+		logger:        log.NewEntry(log.New()),
+		tenantService: noopTenantService{},
+	}
+
+	// Simulate an idle/unidle check that is still running when shutdown is
+	// called, and never finishes on its own.
+	idler.opWg.Add(1)
+	defer idler.opWg.Done()
+
+	shutdownTimeout := 50 * time.Millisecond
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		idler.shutdown(shutdownTimeout)
+	}()
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < shutdownTimeout {
+		t.Fatalf("shutdown() returned after %v, want at least shutdownTimeout = %v", elapsed, shutdownTimeout)
+	}
+}
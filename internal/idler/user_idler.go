@@ -2,6 +2,7 @@ package idler
 
 import (
 	"context"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -9,9 +10,14 @@ import (
 
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/condition"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/idler/pipeline"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/metrics"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/model"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/openshift/client"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/ratelimit"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/tenant"
 	"github.com/fabric8-services/fabric8-jenkins-idler/internal/toggles"
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/transport/sshtunnel"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -25,7 +31,6 @@ var JenkinsServices = []string{"jenkins", "content-repository"}
 const (
 	bufferSize             = 10
 	jenkinsNamespaceSuffix = "-jenkins"
-	jenkinsServiceName     = "jenkins"
 )
 
 // UserIdler is created for each monitored user/namespace.
@@ -36,7 +41,6 @@ type UserIdler struct {
 	openShiftAPI         string
 	openShiftBearerToken string
 	openShiftClient      client.OpenShiftClient
-	maxRetries           int
 	idleAttempts         int
 	unIdleAttempts       int
 	Conditions           *condition.Conditions
@@ -45,11 +49,26 @@ type UserIdler struct {
 	user                 model.User
 	config               configuration.Configuration
 	features             toggles.Features
+	metrics              metrics.Recorder
+	limiter              ratelimit.Limiter
+	tenantService        tenant.Service
+	opWg                 sync.WaitGroup
+
+	// consecutiveFailures and firstFailureAt drive the backoff delay computed
+	// by backoffDelay. consecutiveFailures is reset to zero on the first
+	// checkIdle success; firstFailureAt is set afresh on the next failure.
+	consecutiveFailures int
+	firstFailureAt      time.Time
 }
 
 // NewUserIdler creates an instance of UserIdler.
-// It returns a pointer to UserIdler,
-func NewUserIdler(user model.User, openShiftAPI string, openShiftBearerToken string, config configuration.Configuration, features toggles.Features) *UserIdler {
+// When config.GetSSHTunnelEnabled is set, openShiftAPI and the proxy URL used
+// for the "user" idle condition are routed through tunnels dialed by tunnels.
+// Passing the same Pool to every UserIdler for a cluster means they all reuse
+// one tunnel to that cluster's jump host instead of each dialing their own.
+// It returns a pointer to UserIdler, or an error if either tunnel fails to
+// start.
+func NewUserIdler(ctx context.Context, user model.User, openShiftAPI string, openShiftBearerToken string, config configuration.Configuration, features toggles.Features, recorder metrics.Recorder, limiter ratelimit.Limiter, tenantService tenant.Service, tunnels *sshtunnel.Pool) (*UserIdler, error) {
 	logEntry := log.WithFields(log.Fields{
 		"component": "user-idler",
 		"username":  user.Name,
@@ -57,7 +76,28 @@ func NewUserIdler(user model.User, openShiftAPI string, openShiftBearerToken str
 	})
 	logEntry.Info("UserIdler created.")
 
-	conditions := createWatchConditions(config.GetProxyURL(), config.GetIdleAfter(), logEntry)
+	tunnel := sshtunnel.Config{
+		Enabled:    config.GetSSHTunnelEnabled(),
+		Addr:       config.GetSSHTunnelAddr(),
+		User:       config.GetSSHTunnelUser(),
+		PrivateKey: config.GetSSHTunnelPrivateKey(),
+		HostKey:    config.GetSSHTunnelHostKey(),
+	}
+
+	openShiftAPI, err := tunnels.Rewrite(ctx, tunnel, openShiftAPI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach OpenShift API: %v", err)
+	}
+
+	proxyURL := config.GetProxyURL()
+	if proxyURL != "" {
+		proxyURL, err = tunnels.Rewrite(ctx, tunnel, proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to reach OpenShift proxy: %v", err)
+		}
+	}
+
+	conditions := createWatchConditions(proxyURL, config.GetIdleAfter(), logEntry)
 
 	userChan := make(chan model.User, bufferSize)
 
@@ -65,7 +105,6 @@ func NewUserIdler(user model.User, openShiftAPI string, openShiftBearerToken str
 		openShiftAPI:         openShiftAPI,
 		openShiftBearerToken: openShiftBearerToken,
 		openShiftClient:      client.NewOpenShift(),
-		maxRetries:           config.GetMaxRetries(),
 		idleAttempts:         0,
 		unIdleAttempts:       0,
 		Conditions:           conditions,
@@ -74,8 +113,11 @@ func NewUserIdler(user model.User, openShiftAPI string, openShiftBearerToken str
 		user:                 user,
 		config:               config,
 		features:             features,
+		metrics:              recorder,
+		limiter:              limiter,
+		tenantService:        tenantService,
 	}
-	return &userIdler
+	return &userIdler, nil
 }
 
 // GetUser returns the model.User of this idler.
@@ -90,152 +132,280 @@ func (idler *UserIdler) GetChannel() chan model.User {
 
 // checkIdle verifies the state of conditions and decides if we should idle/unidle
 // and performs the required action if needed.
-func (idler *UserIdler) checkIdle() error {
-	eval, errors := idler.Conditions.Eval(idler.user)
+func (idler *UserIdler) checkIdle(ctx context.Context, user model.User) error {
+	defer metrics.TimeCheckIdle(idler.metrics)()
+
+	eval, errors := idler.Conditions.Eval(user)
 	if !errors.Empty() {
 		return errors.ToError()
 	}
 
 	idler.logger.WithField("eval", eval).Debug("Check idle state")
 	if eval {
-		enabled, err := idler.isIdlerEnabled()
+		idler.metrics.ConditionEval("aggregate", "idle")
+		enabled, err := idler.isIdlerEnabled(user)
 		if err != nil {
 			return err
 		}
 		if enabled {
-			idler.doIdle()
+			return idler.doIdle(ctx, user)
 		}
-	} else {
-		idler.doUnIdle()
+		return nil
 	}
 
-	return nil
+	idler.metrics.ConditionEval("aggregate", "unidle")
+	return idler.doUnIdle(ctx, user)
 }
 
 // Run runs/starts the Idler
-// It checks if Jenkins is idle at every checkIdle duration.
-func (idler *UserIdler) Run(ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc, checkIdle time.Duration, maxRetriesQuietInterval time.Duration) {
-	idler.logger.WithFields(log.Fields{"checkIdle": fmt.Sprintf("%.0fm", checkIdle.Minutes()), "maxRetriesQuietInterval": fmt.Sprintf("%.0fm", maxRetriesQuietInterval.Minutes())}).Info("UserIdler started.")
+// It checks if Jenkins is idle at every checkIdle duration. Each check runs
+// in its own goroutine, tracked by idler.opWg, so a slow or stuck OpenShift
+// call cannot block this loop from reacting to ctx.Done(); at most one check
+// is ever in flight; a user or timer event that arrives while one is already
+// running is absorbed by updating idler.user and is picked up by the next
+// check. A failed check re-arms the timer with an exponential backoff (see
+// backoffDelay) instead of the normal checkIdle interval, so a run of
+// transient OpenShift errors doesn't freeze idling for the tenant; the first
+// success afterwards resets the backoff. On ctx cancellation it stops
+// accepting new users, waits up to shutdownTimeout for any in-flight
+// idle/unidle to finish and deregisters the tenant before returning.
+func (idler *UserIdler) Run(ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc, checkIdle time.Duration, shutdownTimeout time.Duration) {
+	idler.logger.WithFields(log.Fields{"checkIdle": fmt.Sprintf("%.0fm", checkIdle.Minutes())}).Info("UserIdler started.")
 	wg.Add(1)
 	go func() {
-		ticker := time.Tick(maxRetriesQuietInterval)
 		timer := time.After(checkIdle)
+		idler.metrics.IncActiveUserIdlers()
+		defer idler.metrics.DecActiveUserIdlers()
 		defer wg.Done()
+
+		var inFlight bool
+		results := make(chan time.Duration, 1)
+		dispatch := func(user model.User) {
+			if inFlight {
+				return
+			}
+			inFlight = true
+			go func() {
+				results <- idler.runCheckIdle(ctx, user, checkIdle)
+			}()
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
-				idler.logger.Info("Shutting down user idler.")
+				idler.shutdown(shutdownTimeout)
 				cancel()
 				return
 			case idler.user = <-idler.userChan:
 				idler.logger.WithField("state", idler.user.String()).Debug("Received user data.")
-
-				err := idler.checkIdle()
-				if err != nil {
-					idler.logger.WithField("error", err.Error()).Warn("Error during idle check.")
-				}
-				// Resetting the timer
-				timer = time.After(checkIdle)
+				dispatch(idler.user)
 			case <-timer:
 				// Timer handles the case where there are no OpenShift events received for the user for the checkIdle
 				// duration. This ensures checkIdle will be called regularly.
 				idler.logger.WithField("state", idler.user.String()).Info("Time based idle check.")
-				err := idler.checkIdle()
-				if err != nil {
-					idler.logger.WithField("error", err.Error()).Warn("Error during idle check.")
-				}
-			case <-ticker:
-				// Using ticker for the resetting of counters to ensure it occurs
-				idler.logger.Debug("Resetting retry counters.")
-				idler.resetCounters()
+				dispatch(idler.user)
+			case next := <-results:
+				inFlight = false
+				timer = time.After(next)
 			}
 		}
 	}()
 }
 
-func (idler *UserIdler) doIdle() error {
-	if idler.idleAttempts >= idler.maxRetries {
-		idler.logger.Warn("Skipping idle request since max retry count has been reached.")
-		return nil
+// runCheckIdle runs a single checkIdle pass and returns the duration the
+// Run loop's timer should be re-armed with: checkIdle on success, or the
+// next backoff delay on failure.
+func (idler *UserIdler) runCheckIdle(ctx context.Context, user model.User, checkIdle time.Duration) time.Duration {
+	err := idler.checkIdleTracked(ctx, user)
+	if err != nil {
+		delay := idler.backoffDelay()
+		idler.logger.WithFields(log.Fields{"error": err.Error(), "backoff": delay.String()}).Warn("Error during idle check, backing off.")
+		return delay
 	}
+	idler.resetBackoff()
+	return checkIdle
+}
 
-	state, err := idler.getJenkinsState()
-	if err != nil {
-		return err
+// checkIdleTracked wraps checkIdle with idler.opWg so shutdown can wait for
+// it to complete.
+func (idler *UserIdler) checkIdleTracked(ctx context.Context, user model.User) error {
+	idler.opWg.Add(1)
+	defer idler.opWg.Done()
+	return idler.checkIdle(ctx, user)
+}
+
+// shutdown logs the termination, waits up to shutdownTimeout for any
+// in-flight idle/unidle to finish and deregisters the tenant. It does not
+// flush metrics: idler.metrics is a single Recorder shared by every
+// UserIdler, so flushing it here would tear it down out from under every
+// other UserIdler still draining; the caller flushes it once, centrally,
+// after every UserIdler has shut down.
+func (idler *UserIdler) shutdown(shutdownTimeout time.Duration) {
+	idler.logger.Info("termination signal received, shutting down")
+
+	done := make(chan struct{})
+	go func() {
+		idler.opWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		idler.logger.Warn("Timed out waiting for in-flight idle/unidle operation to finish.")
 	}
 
-	if state > model.JenkinsIdled {
-		idler.incrementIdleAttempts()
-		for _, service := range JenkinsServices {
-			idler.logger.WithField("attempt", fmt.Sprintf("(%d/%d)", idler.idleAttempts, idler.maxRetries)).Info("About to idle " + service)
-			err := idler.openShiftClient.Idle(idler.openShiftAPI, idler.openShiftBearerToken, idler.user.Name+jenkinsNamespaceSuffix, service)
-			if err != nil {
-				return err
-			}
-		}
+	if err := idler.tenantService.Deregister(idler.user.ID); err != nil {
+		idler.logger.WithField("error", err.Error()).Warn("Error deregistering tenant.")
 	}
-	return nil
 }
 
-func (idler *UserIdler) doUnIdle() error {
-	if idler.unIdleAttempts >= idler.maxRetries {
-		idler.logger.Warn("Skipping un-idle request since max retry count has been reached.")
+// newStateBag seeds a pipeline.StateBag with everything the default steps
+// need to reach the OpenShift API for user.
+func (idler *UserIdler) newStateBag(user model.User) pipeline.StateBag {
+	state := pipeline.NewStateBag()
+	state.Put(pipeline.KeyLogger, idler.logger)
+	state.Put(pipeline.KeyOpenShiftClient, idler.openShiftClient)
+	state.Put(pipeline.KeyLimiter, idler.limiter)
+	state.Put(pipeline.KeyMetrics, idler.metrics)
+	state.Put(pipeline.KeyOpenShiftAPI, idler.openShiftAPI)
+	state.Put(pipeline.KeyBearerToken, idler.openShiftBearerToken)
+	state.Put(pipeline.KeyNamespace, user.Name+jenkinsNamespaceSuffix)
+	return state
+}
+
+// runPipeline executes runner and translates its outcome into the doIdle/
+// doUnIdle return convention: a Requeue re-arms this UserIdler for another
+// attempt after a backoff and surfaces the step's error, while Halt and
+// Continue both mean the run is done and report no error. Steps short-circuit
+// on Requeue before ever reaching a step near the end of the list, so the
+// attempt's result is recorded here rather than by a step — otherwise the
+// failure path could never record anything but metrics.ResultSuccess. Only
+// counted as an attempt at all when KeyActionTaken is true, i.e. this
+// checkIdle tick actually decided to idle/un-idle something.
+func (idler *UserIdler) runPipeline(ctx context.Context, runner *pipeline.Runner, state pipeline.StateBag, user model.User, resultCounter func(metrics.Recorder, string)) error {
+	action := runner.Run(ctx, state)
+	taken, _ := state.Get(pipeline.KeyActionTaken).(bool)
+
+	switch action {
+	case pipeline.Requeue:
+		idler.requeue(user)
+		if taken {
+			resultCounter(idler.metrics, metrics.ResultError)
+		}
+		err, _ := state.Get(pipeline.KeyError).(error)
+		return err
+	default:
+		if taken {
+			resultCounter(idler.metrics, metrics.ResultSuccess)
+		}
 		return nil
 	}
+}
 
-	state, err := idler.getJenkinsState()
-	if err != nil {
-		return err
+// requeue pushes user back onto this idler's own channel after a backoff,
+// so a transient pipeline failure gets retried instead of either blocking
+// the Run loop or being dropped until the next checkIdle tick.
+func (idler *UserIdler) requeue(user model.User) {
+	time.AfterFunc(idler.config.GetPipelineRequeueBackoff(), func() {
+		idler.userChan <- user
+	})
+}
+
+func (idler *UserIdler) doIdle(ctx context.Context, user model.User) error {
+	state := idler.newStateBag(user)
+
+	steps := []pipeline.Step{
+		&pipeline.FetchJenkinsStateStep{},
+		&pipeline.IncrementAttemptsStep{
+			Increment:   func() { idler.incrementIdleAttempts(user) },
+			NeedsAction: func(jenkinsState int) bool { return jenkinsState > model.JenkinsIdled },
+		},
+	}
+	for _, service := range JenkinsServices {
+		steps = append(steps, &pipeline.IdleServiceStep{ServiceName: service})
 	}
+	steps = append(steps, &pipeline.VerifyIdledStep{})
 
-	if state == model.JenkinsIdled {
-		idler.incrementUnIdleAttempts()
-		for _, service := range JenkinsServices {
-			idler.logger.WithField("attempt", fmt.Sprintf("(%d/%d)", idler.unIdleAttempts, idler.maxRetries)).Info("About to un-idle " + service)
-			err := idler.openShiftClient.UnIdle(idler.openShiftAPI, idler.openShiftBearerToken, idler.user.Name+jenkinsNamespaceSuffix, service)
-			if err != nil {
-				return err
-			}
-		}
+	return idler.runPipeline(ctx, pipeline.NewRunner(steps...), state, user, metrics.Recorder.IdleAttempt)
+}
+
+func (idler *UserIdler) doUnIdle(ctx context.Context, user model.User) error {
+	state := idler.newStateBag(user)
+
+	steps := []pipeline.Step{
+		&pipeline.FetchJenkinsStateStep{},
+		&pipeline.IncrementAttemptsStep{
+			Increment:   func() { idler.incrementUnIdleAttempts(user) },
+			NeedsAction: func(jenkinsState int) bool { return jenkinsState == model.JenkinsIdled },
+		},
+	}
+	for _, service := range JenkinsServices {
+		steps = append(steps, &pipeline.UnidleServiceStep{ServiceName: service})
 	}
-	return nil
+	steps = append(steps, &pipeline.VerifyUnidledStep{})
+
+	return idler.runPipeline(ctx, pipeline.NewRunner(steps...), state, user, metrics.Recorder.UnidleAttempt)
 }
 
-func (idler *UserIdler) isIdlerEnabled() (bool, error) {
-	enabled, err := idler.features.IsIdlerEnabled(idler.user.ID)
+func (idler *UserIdler) isIdlerEnabled(user model.User) (bool, error) {
+	enabled, err := idler.features.IsIdlerEnabled(user.ID)
 	if err != nil {
 		return false, err
 	}
 
 	if enabled {
-		logger.WithFields(log.Fields{"user": idler.user.Name, "uuid": idler.user.ID}).Debug("Idler enabled.")
+		logger.WithFields(log.Fields{"user": user.Name, "uuid": user.ID}).Debug("Idler enabled.")
 		return true, nil
 	}
 
-	logger.WithFields(log.Fields{"user": idler.user.Name, "uuid": idler.user.ID}).Debug("Idler not enabled.")
+	logger.WithFields(log.Fields{"user": user.Name, "uuid": user.ID}).Debug("Idler not enabled.")
 	return false, nil
 }
 
-func (idler *UserIdler) getJenkinsState() (int, error) {
-	ns := idler.user.Name + jenkinsNamespaceSuffix
-	state, err := idler.openShiftClient.IsIdle(idler.openShiftAPI, idler.openShiftBearerToken, ns, jenkinsServiceName)
-	if err != nil {
-		return -1, err
-	}
-	return state, nil
-}
-
-func (idler *UserIdler) incrementIdleAttempts() {
+func (idler *UserIdler) incrementIdleAttempts(user model.User) {
 	idler.idleAttempts++
+	idler.metrics.SetIdleAttempts(user.Name, idler.idleAttempts)
 }
 
-func (idler *UserIdler) incrementUnIdleAttempts() {
+func (idler *UserIdler) incrementUnIdleAttempts(user model.User) {
 	idler.unIdleAttempts++
+	idler.metrics.SetUnidleAttempts(user.Name, idler.unIdleAttempts)
+}
+
+// backoffDelay computes the delay before the next checkIdle attempt after a
+// failure: min(base*2^attempt, cap) plus a random jitter in [0, jitter), and
+// records the failure so the delay keeps growing across consecutive calls.
+// If the failure streak has been going on longer than the configured
+// max-elapsed-time, it logs a warning on each further failure and keeps
+// retrying at the capped delay rather than giving up on the tenant.
+func (idler *UserIdler) backoffDelay() time.Duration {
+	if idler.consecutiveFailures == 0 {
+		idler.firstFailureAt = time.Now()
+	}
+	idler.consecutiveFailures++
+
+	if maxElapsed := idler.config.GetBackoffMaxElapsedTime(); maxElapsed > 0 {
+		if elapsed := time.Since(idler.firstFailureAt); elapsed > maxElapsed {
+			idler.logger.WithField("elapsed", elapsed.String()).Warn("Idle check has been failing for longer than the configured max elapsed time, continuing to retry at the capped backoff.")
+		}
+	}
+
+	capped := idler.config.GetBackoffCap()
+	delay := idler.config.GetBackoffBase() << uint(idler.consecutiveFailures-1)
+	if delay <= 0 || delay > capped {
+		delay = capped
+	}
+
+	if jitter := idler.config.GetBackoffJitter(); jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return delay
 }
 
-func (idler *UserIdler) resetCounters() {
-	idler.idleAttempts = 0
-	idler.unIdleAttempts = 0
+// resetBackoff clears the failure streak tracked by backoffDelay. Called on
+// the first successful checkIdle after one or more failures.
+func (idler *UserIdler) resetBackoff() {
+	idler.consecutiveFailures = 0
 }
 
 func createWatchConditions(proxyURL string, idleAfter int, logEntry *log.Entry) *condition.Conditions {
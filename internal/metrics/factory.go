@@ -0,0 +1,20 @@
+package metrics
+
+import "github.com/fabric8-services/fabric8-jenkins-idler/internal/configuration"
+
+// Exporter names accepted by configuration.Configuration.GetMetricsExporter.
+const (
+	ExporterPrometheus = "prometheus"
+	ExporterStatsd     = "statsd"
+)
+
+// NewRecorder builds the Recorder selected by config.GetMetricsExporter(),
+// defaulting to Prometheus when unset or unrecognised.
+func NewRecorder(config configuration.Configuration) (Recorder, error) {
+	switch config.GetMetricsExporter() {
+	case ExporterStatsd:
+		return NewStatsdRecorder(config.GetStatsdAddress())
+	default:
+		return NewPrometheusRecorder(), nil
+	}
+}
@@ -0,0 +1,217 @@
+// Package metrics exposes fine-grained counters, gauges and histograms for
+// the idle/unidle pipeline so fleet-wide behaviour can be observed instead
+// of grepped out of log lines.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Result labels used across the *_attempts_total counters.
+const (
+	ResultSuccess           = "success"
+	ResultError             = "error"
+	ResultSkippedMaxRetries = "skipped_max_retries"
+)
+
+// OpenShift call labels used for idler_openshift_call_seconds.
+const (
+	OpIdle   = "idle"
+	OpUnIdle = "unidle"
+	OpIsIdle = "is_idle"
+)
+
+// Recorder is the instrumentation surface used by the idler package. It is
+// implemented by a Prometheus and a statsd backed recorder so the exporter
+// can be chosen via configuration.Configuration without touching call sites.
+type Recorder interface {
+	// IdleAttempt records the outcome of a single doIdle invocation.
+	IdleAttempt(result string)
+	// UnidleAttempt records the outcome of a single doUnIdle invocation.
+	UnidleAttempt(result string)
+	// ConditionEval records the outcome of evaluating a named condition.
+	ConditionEval(condition string, result string)
+	// OpenShiftCall records how long an OpenShift API call took.
+	OpenShiftCall(op string, duration time.Duration)
+	// CheckIdle records how long a full checkIdle pass took.
+	CheckIdle(duration time.Duration)
+	// IncActiveUserIdlers increments the number of currently running UserIdler goroutines.
+	IncActiveUserIdlers()
+	// DecActiveUserIdlers decrements the number of currently running UserIdler goroutines.
+	DecActiveUserIdlers()
+	// SetIdleAttempts records the current idle attempt counter for a user.
+	SetIdleAttempts(user string, n int)
+	// SetUnidleAttempts records the current un-idle attempt counter for a user.
+	SetUnidleAttempts(user string, n int)
+	// SetRateLimiterQueueDepth records how many callers are currently
+	// blocked waiting for a token in the given rate limiter bucket.
+	SetRateLimiterQueueDepth(bucket string, depth int64)
+	// Handler returns the HTTP handler to be mounted at /metrics, or nil if
+	// the backend does not expose a scrape endpoint (e.g. statsd).
+	Handler() http.Handler
+	// Flush blocks until any buffered metrics have been pushed to the
+	// backend. Called during graceful shutdown so final readings aren't
+	// lost. A no-op for pull-based backends such as Prometheus.
+	Flush() error
+}
+
+// TimeOpenShiftCall returns a func that records the elapsed time since it was
+// obtained as an idler_openshift_call_seconds observation. Typical use:
+//
+//	defer metrics.TimeOpenShiftCall(recorder, metrics.OpIdle)()
+func TimeOpenShiftCall(r Recorder, op string) func() {
+	start := time.Now()
+	return func() {
+		r.OpenShiftCall(op, time.Since(start))
+	}
+}
+
+// TimeCheckIdle returns a func that records the elapsed time since it was
+// obtained as an idler_check_idle_seconds observation.
+func TimeCheckIdle(r Recorder) func() {
+	start := time.Now()
+	return func() {
+		r.CheckIdle(time.Since(start))
+	}
+}
+
+const namespace = "idler"
+
+// prometheusRecorder is the default Recorder backend.
+type prometheusRecorder struct {
+	idleAttempts      *prometheus.CounterVec
+	unidleAttempts    *prometheus.CounterVec
+	conditionEval     *prometheus.CounterVec
+	openShiftCallSecs *prometheus.HistogramVec
+	checkIdleSecs     prometheus.Histogram
+	activeUserIdlers  prometheus.Gauge
+	idleAttemptsGauge *prometheus.GaugeVec
+	unidleAttemptsG   *prometheus.GaugeVec
+	rateLimitQueue    *prometheus.GaugeVec
+	registry          *prometheus.Registry
+}
+
+// NewPrometheusRecorder creates a Recorder backed by a dedicated Prometheus
+// registry and registers all collectors on it.
+func NewPrometheusRecorder() Recorder {
+	registry := prometheus.NewRegistry()
+
+	r := &prometheusRecorder{
+		idleAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "idle_attempts_total",
+			Help:      "Total number of idle attempts by result.",
+		}, []string{"result"}),
+		unidleAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "unidle_attempts_total",
+			Help:      "Total number of un-idle attempts by result.",
+		}, []string{"result"}),
+		conditionEval: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "condition_eval_total",
+			Help:      "Total number of condition evaluations by condition and result.",
+		}, []string{"condition", "result"}),
+		openShiftCallSecs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "openshift_call_seconds",
+			Help:      "Latency of OpenShift client calls by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+		checkIdleSecs: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "check_idle_seconds",
+			Help:      "Latency of a full checkIdle pass.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		activeUserIdlers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_user_idlers",
+			Help:      "Number of UserIdler goroutines currently running.",
+		}),
+		idleAttemptsGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "idle_attempts",
+			Help:      "Current idle attempt counter per user.",
+		}, []string{"user"}),
+		unidleAttemptsG: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "unidle_attempts",
+			Help:      "Current un-idle attempt counter per user.",
+		}, []string{"user"}),
+		rateLimitQueue: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ratelimit_queue_depth",
+			Help:      "Number of callers currently blocked waiting for a rate limiter token, per bucket.",
+		}, []string{"bucket"}),
+		registry: registry,
+	}
+
+	registry.MustRegister(
+		r.idleAttempts,
+		r.unidleAttempts,
+		r.conditionEval,
+		r.openShiftCallSecs,
+		r.checkIdleSecs,
+		r.activeUserIdlers,
+		r.idleAttemptsGauge,
+		r.unidleAttemptsG,
+		r.rateLimitQueue,
+	)
+
+	return r
+}
+
+func (r *prometheusRecorder) IdleAttempt(result string) {
+	r.idleAttempts.WithLabelValues(result).Inc()
+}
+
+func (r *prometheusRecorder) UnidleAttempt(result string) {
+	r.unidleAttempts.WithLabelValues(result).Inc()
+}
+
+func (r *prometheusRecorder) ConditionEval(condition string, result string) {
+	r.conditionEval.WithLabelValues(condition, result).Inc()
+}
+
+func (r *prometheusRecorder) OpenShiftCall(op string, duration time.Duration) {
+	r.openShiftCallSecs.WithLabelValues(op).Observe(duration.Seconds())
+}
+
+func (r *prometheusRecorder) CheckIdle(duration time.Duration) {
+	r.checkIdleSecs.Observe(duration.Seconds())
+}
+
+func (r *prometheusRecorder) IncActiveUserIdlers() {
+	r.activeUserIdlers.Inc()
+}
+
+func (r *prometheusRecorder) DecActiveUserIdlers() {
+	r.activeUserIdlers.Dec()
+}
+
+func (r *prometheusRecorder) SetIdleAttempts(user string, n int) {
+	r.idleAttemptsGauge.WithLabelValues(user).Set(float64(n))
+}
+
+func (r *prometheusRecorder) SetUnidleAttempts(user string, n int) {
+	r.unidleAttemptsG.WithLabelValues(user).Set(float64(n))
+}
+
+func (r *prometheusRecorder) SetRateLimiterQueueDepth(bucket string, depth int64) {
+	r.rateLimitQueue.WithLabelValues(bucket).Set(float64(depth))
+}
+
+func (r *prometheusRecorder) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
+
+// Flush is a no-op: Prometheus scrapes the /metrics endpoint, it is never
+// pushed to.
+func (r *prometheusRecorder) Flush() error {
+	return nil
+}
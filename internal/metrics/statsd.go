@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+// statsdRecorder mirrors prometheusRecorder's metric names as statsd
+// counters, timers and gauges for operators who ship to a statsd collector
+// instead of scraping Prometheus.
+type statsdRecorder struct {
+	client statsd.Statter
+}
+
+// NewStatsdRecorder creates a Recorder that emits to the statsd collector at
+// addr, prefixing every metric with "idler.".
+func NewStatsdRecorder(addr string) (Recorder, error) {
+	client, err := statsd.NewClient(addr, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdRecorder{client: client}, nil
+}
+
+func (r *statsdRecorder) IdleAttempt(result string) {
+	r.client.Inc("idle_attempts_total."+result, 1, 1.0)
+}
+
+func (r *statsdRecorder) UnidleAttempt(result string) {
+	r.client.Inc("unidle_attempts_total."+result, 1, 1.0)
+}
+
+func (r *statsdRecorder) ConditionEval(condition string, result string) {
+	r.client.Inc("condition_eval_total."+condition+"."+result, 1, 1.0)
+}
+
+func (r *statsdRecorder) OpenShiftCall(op string, duration time.Duration) {
+	r.client.TimingDuration("openshift_call_seconds."+op, duration, 1.0)
+}
+
+func (r *statsdRecorder) CheckIdle(duration time.Duration) {
+	r.client.TimingDuration("check_idle_seconds", duration, 1.0)
+}
+
+func (r *statsdRecorder) IncActiveUserIdlers() {
+	r.client.Inc("active_user_idlers", 1, 1.0)
+}
+
+func (r *statsdRecorder) DecActiveUserIdlers() {
+	r.client.Dec("active_user_idlers", 1, 1.0)
+}
+
+func (r *statsdRecorder) SetIdleAttempts(user string, n int) {
+	r.client.Gauge("idle_attempts."+user, int64(n), 1.0)
+}
+
+func (r *statsdRecorder) SetUnidleAttempts(user string, n int) {
+	r.client.Gauge("unidle_attempts."+user, int64(n), 1.0)
+}
+
+func (r *statsdRecorder) SetRateLimiterQueueDepth(bucket string, depth int64) {
+	r.client.Gauge("ratelimit_queue_depth."+bucket, depth, 1.0)
+}
+
+// Handler returns nil: statsd is push-based and does not expose a scrape
+// endpoint.
+func (r *statsdRecorder) Handler() http.Handler {
+	return nil
+}
+
+// Flush closes the statsd client, which blocks until its underlying
+// connection has sent any buffered packets.
+func (r *statsdRecorder) Flush() error {
+	return r.client.Close()
+}
@@ -0,0 +1,122 @@
+// Package ratelimit throttles calls to the OpenShift API so that many
+// UserIdler goroutines flapping at once cannot burst the apiserver of a
+// single cluster. It follows the token-bucket-plus-jitter pattern used by
+// GCE-style cloud providers: calls block until a token is available, and a
+// refused call backs off for a random jitter before retrying rather than
+// hammering the bucket in a tight loop.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/fabric8-services/fabric8-jenkins-idler/internal/metrics"
+)
+
+// Limiter throttles calls keyed by an arbitrary bucket, typically the
+// OpenShift cluster API URL being called.
+type Limiter interface {
+	// Wait blocks until a call against bucket is allowed, or returns an
+	// error once maxConsecutiveErrors refusals have been seen in a row, or
+	// if ctx is done first.
+	Wait(ctx context.Context, bucket string) error
+	// QueueDepth returns the number of callers currently blocked in Wait.
+	QueueDepth() int64
+}
+
+// clusterBucket is one cluster's token bucket together with the depth of
+// callers currently blocked in Wait for that bucket specifically, so a busy
+// bucket's queue never bleeds into another bucket's reported depth.
+type clusterBucket struct {
+	limiter    *rate.Limiter
+	queueDepth int64
+}
+
+// clusterLimiter is a Limiter with one token bucket per cluster API URL.
+type clusterLimiter struct {
+	mu                   sync.Mutex
+	buckets              map[string]*clusterBucket
+	maxCalls             int
+	per                  time.Duration
+	maxConsecutiveErrors int
+	metrics              metrics.Recorder
+}
+
+// New creates a Limiter allowing maxCalls calls per `per` duration for any
+// given bucket, giving up and returning an error after maxConsecutiveErrors
+// refusals in a row. Queue depth, keyed by bucket, is reported on recorder.
+func New(maxCalls int, per time.Duration, maxConsecutiveErrors int, recorder metrics.Recorder) Limiter {
+	return &clusterLimiter{
+		buckets:              make(map[string]*clusterBucket),
+		maxCalls:             maxCalls,
+		per:                  per,
+		maxConsecutiveErrors: maxConsecutiveErrors,
+		metrics:              recorder,
+	}
+}
+
+func (l *clusterLimiter) Wait(ctx context.Context, bucket string) error {
+	b := l.bucketFor(bucket)
+
+	depth := atomic.AddInt64(&b.queueDepth, 1)
+	l.metrics.SetRateLimiterQueueDepth(bucket, depth)
+	defer func() {
+		depth := atomic.AddInt64(&b.queueDepth, -1)
+		l.metrics.SetRateLimiterQueueDepth(bucket, depth)
+	}()
+
+	consecutiveErrors := 0
+	for {
+		if b.limiter.Allow() {
+			return nil
+		}
+
+		consecutiveErrors++
+		if consecutiveErrors >= l.maxConsecutiveErrors {
+			return fmt.Errorf("ratelimit: bucket %q refused %d consecutive calls", bucket, consecutiveErrors)
+		}
+
+		jitter := time.Duration(rand.Intn(1000)) * time.Millisecond
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter):
+		}
+	}
+}
+
+// QueueDepth returns the total number of callers currently blocked in Wait,
+// summed across every bucket.
+func (l *clusterLimiter) QueueDepth() int64 {
+	l.mu.Lock()
+	buckets := make([]*clusterBucket, 0, len(l.buckets))
+	for _, b := range l.buckets {
+		buckets = append(buckets, b)
+	}
+	l.mu.Unlock()
+
+	var total int64
+	for _, b := range buckets {
+		total += atomic.LoadInt64(&b.queueDepth)
+	}
+	return total
+}
+
+func (l *clusterLimiter) bucketFor(bucket string) *clusterBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[bucket]; ok {
+		return b
+	}
+
+	b := &clusterBucket{limiter: rate.NewLimiter(rate.Limit(float64(l.maxCalls)/l.per.Seconds()), l.maxCalls)}
+	l.buckets[bucket] = b
+	return b
+}
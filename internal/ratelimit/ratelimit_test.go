@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingRecorder stubs metrics.Recorder, capturing every
+// SetRateLimiterQueueDepth call so tests can assert the queue depth gauge
+// goes up and back down around a blocked Wait.
+type recordingRecorder struct {
+	mu             sync.Mutex
+	depths         []int64
+	depthsByBucket map[string][]int64
+}
+
+func (r *recordingRecorder) IdleAttempt(result string)                       {}
+func (r *recordingRecorder) UnidleAttempt(result string)                     {}
+func (r *recordingRecorder) ConditionEval(condition string, result string)   {}
+func (r *recordingRecorder) OpenShiftCall(op string, duration time.Duration) {}
+func (r *recordingRecorder) CheckIdle(duration time.Duration)                {}
+func (r *recordingRecorder) IncActiveUserIdlers()                            {}
+func (r *recordingRecorder) DecActiveUserIdlers()                            {}
+func (r *recordingRecorder) SetIdleAttempts(user string, n int)              {}
+func (r *recordingRecorder) SetUnidleAttempts(user string, n int)            {}
+func (r *recordingRecorder) Handler() http.Handler                           { return nil }
+func (r *recordingRecorder) Flush() error                                    { return nil }
+
+func (r *recordingRecorder) SetRateLimiterQueueDepth(bucket string, depth int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.depths = append(r.depths, depth)
+	if r.depthsByBucket == nil {
+		r.depthsByBucket = make(map[string][]int64)
+	}
+	r.depthsByBucket[bucket] = append(r.depthsByBucket[bucket], depth)
+}
+
+func TestWaitAllowsCallsWithinTheLimit(t *testing.T) {
+	recorder := &recordingRecorder{}
+	limiter := New(1, time.Minute, 5, recorder)
+
+	if err := limiter.Wait(context.Background(), "cluster-a"); err != nil {
+		t.Fatalf("Wait() error = %v, want nil", err)
+	}
+}
+
+func TestWaitReturnsErrorAfterMaxConsecutiveRefusals(t *testing.T) {
+	recorder := &recordingRecorder{}
+	limiter := New(1, time.Hour, 3, recorder)
+
+	// Exhaust the bucket's only token.
+	if err := limiter.Wait(context.Background(), "cluster-a"); err != nil {
+		t.Fatalf("first Wait() error = %v, want nil", err)
+	}
+
+	err := limiter.Wait(context.Background(), "cluster-a")
+	if err == nil {
+		t.Fatal("Wait() error = nil, want error after maxConsecutiveErrors refusals")
+	}
+}
+
+func TestWaitBucketsAreIndependent(t *testing.T) {
+	recorder := &recordingRecorder{}
+	limiter := New(1, time.Hour, 1, recorder)
+
+	if err := limiter.Wait(context.Background(), "cluster-a"); err != nil {
+		t.Fatalf("Wait(cluster-a) error = %v, want nil", err)
+	}
+	if err := limiter.Wait(context.Background(), "cluster-b"); err != nil {
+		t.Fatalf("Wait(cluster-b) error = %v, want nil: exhausting bucket-a's only token should not affect bucket-b", err)
+	}
+}
+
+func TestWaitReturnsCtxErrWhenCtxDoneBeforeRefusalLimit(t *testing.T) {
+	recorder := &recordingRecorder{}
+	limiter := New(1, time.Hour, 1000, recorder)
+
+	if err := limiter.Wait(context.Background(), "cluster-a"); err != nil {
+		t.Fatalf("first Wait() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx, "cluster-a"); err != context.Canceled {
+		t.Fatalf("Wait() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitReportsQueueDepthWhileBlocked(t *testing.T) {
+	recorder := &recordingRecorder{}
+	limiter := New(1, time.Hour, 1000, recorder)
+
+	if err := limiter.Wait(context.Background(), "cluster-a"); err != nil {
+		t.Fatalf("first Wait() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		limiter.Wait(ctx, "cluster-a")
+		close(done)
+	}()
+
+	// While the second Wait is blocked refusing/retrying, QueueDepth should
+	// reflect it being in flight.
+	time.Sleep(5 * time.Millisecond)
+	if depth := limiter.QueueDepth(); depth != 1 {
+		t.Fatalf("QueueDepth() while blocked = %d, want 1", depth)
+	}
+
+	<-done
+	if depth := limiter.QueueDepth(); depth != 0 {
+		t.Fatalf("QueueDepth() after Wait returned = %d, want 0", depth)
+	}
+}
+
+func TestSetRateLimiterQueueDepthDoesNotMislabelIdleBucket(t *testing.T) {
+	recorder := &recordingRecorder{}
+	limiter := New(1, time.Hour, 1000, recorder)
+
+	if err := limiter.Wait(context.Background(), "cluster-a"); err != nil {
+		t.Fatalf("first Wait(cluster-a) error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		limiter.Wait(ctx, "cluster-a")
+		close(done)
+	}()
+
+	// While cluster-a's second Wait is blocked refusing/retrying, an
+	// untouched cluster-b must never be reported with a nonzero queue depth
+	// just because cluster-a has blocked callers.
+	time.Sleep(5 * time.Millisecond)
+	if err := limiter.Wait(context.Background(), "cluster-b"); err != nil {
+		t.Fatalf("Wait(cluster-b) error = %v, want nil", err)
+	}
+
+	<-done
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, depth := range recorder.depthsByBucket["cluster-b"] {
+		if depth != 1 && depth != 0 {
+			t.Fatalf("SetRateLimiterQueueDepth(cluster-b, ...) saw %d, want only 0 or 1 (cluster-a's queue must not leak into cluster-b)", depth)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Package sshtunnel forwards local TCP connections to a remote host:port
+// over SSH, the same `ssh -L` pattern jenkins-client-launcher uses via its
+// forwardLocalConnectionsTo helper. It lets the idler reach OpenShift/Jenkins
+// endpoints on clusters that are not directly routable from wherever the
+// idler runs, by dialing a jump host and substituting the tunnel's local
+// address for the real one.
+package sshtunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var logger = log.WithFields(log.Fields{"component": "ssh-tunnel"})
+
+const (
+	keepaliveInterval = 30 * time.Second
+	minBackoff        = time.Second
+	maxBackoff        = time.Minute
+)
+
+// Tunnel maintains a persistent SSH connection to sshAddr and forwards every
+// connection accepted on its local listener to remoteAddr.
+type Tunnel struct {
+	sshAddr      string
+	remoteAddr   string
+	clientConfig *ssh.ClientConfig
+	logger       *log.Entry
+
+	mu       sync.Mutex
+	client   *ssh.Client
+	listener net.Listener
+}
+
+// New creates a Tunnel that, once started, forwards local connections to
+// remoteAddr through an SSH connection to sshAddr.
+func New(sshAddr string, remoteAddr string, clientConfig *ssh.ClientConfig) *Tunnel {
+	return &Tunnel{
+		sshAddr:      sshAddr,
+		remoteAddr:   remoteAddr,
+		clientConfig: clientConfig,
+		logger:       logger.WithField("remote", remoteAddr),
+	}
+}
+
+// Start opens a local listener on an ephemeral port, establishes the initial
+// SSH connection, and begins forwarding accepted connections. It returns the
+// local address to substitute for remoteAddr. A background goroutine keeps
+// the SSH connection alive with periodic keepalives and reconnects with
+// backoff if it drops, until ctx is done.
+func (t *Tunnel) Start(ctx context.Context) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("sshtunnel: unable to open local listener: %v", err)
+	}
+	t.listener = listener
+
+	if err := t.connect(); err != nil {
+		listener.Close()
+		return "", err
+	}
+
+	go t.acceptLoop(ctx)
+	go t.maintainConnection(ctx)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+func (t *Tunnel) connect() error {
+	client, err := ssh.Dial("tcp", t.sshAddr, t.clientConfig)
+	if err != nil {
+		return fmt.Errorf("sshtunnel: unable to dial %s: %v", t.sshAddr, err)
+	}
+
+	t.mu.Lock()
+	t.client = client
+	t.mu.Unlock()
+	return nil
+}
+
+// maintainConnection sends periodic keepalives over the current SSH
+// connection and, once one fails, reconnects with an exponential backoff.
+func (t *Tunnel) maintainConnection(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(keepaliveInterval):
+		}
+
+		t.mu.Lock()
+		client := t.client
+		t.mu.Unlock()
+
+		if client == nil || !t.keepalive(client) {
+			t.logger.Warn("SSH tunnel disconnected, reconnecting.")
+			t.mu.Lock()
+			t.client = nil
+			t.mu.Unlock()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				if err := t.connect(); err != nil {
+					t.logger.WithField("error", err.Error()).Warn("Error reconnecting SSH tunnel.")
+					if backoff < maxBackoff {
+						backoff *= 2
+					}
+					if backoff > maxBackoff {
+						backoff = maxBackoff
+					}
+					continue
+				}
+				backoff = minBackoff
+				break
+			}
+		}
+	}
+}
+
+func (t *Tunnel) keepalive(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
+
+func (t *Tunnel) acceptLoop(ctx context.Context) {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				t.logger.WithField("error", err.Error()).Warn("Error accepting local connection.")
+				continue
+			}
+		}
+		go t.forward(conn)
+	}
+}
+
+// Config holds the settings needed to dial an SSH tunnel to one jump host.
+type Config struct {
+	// Enabled controls whether Rewrite tunnels at all.
+	Enabled bool
+	// Addr is the jump host to dial, e.g. "bastion.example.com:22".
+	Addr string
+	// User is the SSH user to authenticate as.
+	User string
+	// PrivateKey is a PEM-encoded private key authenticating User.
+	PrivateKey string
+	// HostKey is the expected host key of Addr, in authorized_keys format.
+	HostKey string
+}
+
+func (cfg Config) clientConfig() (*ssh.ClientConfig, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("sshtunnel: unable to parse private key: %v", err)
+	}
+
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("sshtunnel: unable to parse host key: %v", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// Rewrite substitutes rawURL's host with the local address of a freshly
+// dialed Tunnel to cfg.Addr, so a caller that is not directly routable to
+// rawURL's host can still reach it. It returns rawURL unchanged if
+// cfg.Enabled is false.
+//
+// Each call starts its own Tunnel. Callers that need to reach several URLs
+// on the same remote cluster (e.g. every UserIdler talking to the same
+// OpenShift API) should use a Pool instead, so they share one Tunnel rather
+// than each dialing their own.
+func Rewrite(ctx context.Context, cfg Config, rawURL string) (string, error) {
+	if !cfg.Enabled {
+		return rawURL, nil
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("sshtunnel: unable to parse %q: %v", rawURL, err)
+	}
+
+	clientConfig, err := cfg.clientConfig()
+	if err != nil {
+		return "", err
+	}
+
+	localAddr, err := New(cfg.Addr, target.Host, clientConfig).Start(ctx)
+	if err != nil {
+		return "", fmt.Errorf("sshtunnel: unable to start tunnel to %q: %v", target.Host, err)
+	}
+
+	target.Host = localAddr
+	return target.String(), nil
+}
+
+// Pool caches one Tunnel per remote host:port, so every caller that needs to
+// reach the same cluster through the same jump host shares a single dialed
+// SSH connection instead of each opening its own.
+type Pool struct {
+	mu      sync.Mutex
+	tunnels map[string]*pooledTunnel
+}
+
+type pooledTunnel struct {
+	once      sync.Once
+	localAddr string
+	err       error
+}
+
+// NewPool creates an empty Pool.
+func NewPool() *Pool {
+	return &Pool{tunnels: make(map[string]*pooledTunnel)}
+}
+
+// Rewrite behaves like the package-level Rewrite, except that repeated calls
+// for the same cfg.Addr and rawURL host reuse the first call's Tunnel
+// instead of dialing a new one.
+func (p *Pool) Rewrite(ctx context.Context, cfg Config, rawURL string) (string, error) {
+	if !cfg.Enabled {
+		return rawURL, nil
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("sshtunnel: unable to parse %q: %v", rawURL, err)
+	}
+
+	key := cfg.Addr + "->" + target.Host
+
+	p.mu.Lock()
+	pt, ok := p.tunnels[key]
+	if !ok {
+		pt = &pooledTunnel{}
+		p.tunnels[key] = pt
+	}
+	p.mu.Unlock()
+
+	pt.once.Do(func() {
+		clientConfig, err := cfg.clientConfig()
+		if err != nil {
+			pt.err = err
+			return
+		}
+		pt.localAddr, pt.err = New(cfg.Addr, target.Host, clientConfig).Start(ctx)
+		if pt.err != nil {
+			pt.err = fmt.Errorf("sshtunnel: unable to start tunnel to %q: %v", target.Host, pt.err)
+		}
+	})
+	if pt.err != nil {
+		return "", pt.err
+	}
+
+	target.Host = pt.localAddr
+	return target.String(), nil
+}
+
+func (t *Tunnel) forward(local net.Conn) {
+	t.mu.Lock()
+	client := t.client
+	t.mu.Unlock()
+
+	if client == nil {
+		local.Close()
+		return
+	}
+
+	remote, err := client.Dial("tcp", t.remoteAddr)
+	if err != nil {
+		t.logger.WithField("error", err.Error()).Warn("Error dialing remote endpoint over SSH.")
+		local.Close()
+		return
+	}
+
+	go func() {
+		defer local.Close()
+		defer remote.Close()
+		io.Copy(remote, local)
+	}()
+	go func() {
+		defer local.Close()
+		defer remote.Close()
+		io.Copy(local, remote)
+	}()
+}
@@ -0,0 +1,50 @@
+package sshtunnel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRewriteReturnsRawURLUnchangedWhenDisabled(t *testing.T) {
+	rawURL := "https://api.example.com:8443"
+	got, err := Rewrite(context.Background(), Config{Enabled: false}, rawURL)
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v, want nil", err)
+	}
+	if got != rawURL {
+		t.Fatalf("Rewrite() = %q, want %q", got, rawURL)
+	}
+}
+
+func TestPoolRewriteReturnsRawURLUnchangedWhenDisabled(t *testing.T) {
+	rawURL := "https://api.example.com:8443"
+	got, err := NewPool().Rewrite(context.Background(), Config{Enabled: false}, rawURL)
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v, want nil", err)
+	}
+	if got != rawURL {
+		t.Fatalf("Rewrite() = %q, want %q", got, rawURL)
+	}
+}
+
+// TestPoolRewriteReusesCachedTunnelForSameHost pre-populates a Pool with an
+// entry whose once has already fired, keyed the same way Rewrite computes it,
+// to confirm a second call for the same cfg.Addr/host reuses that entry's
+// localAddr rather than dialing a new Tunnel.
+func TestPoolRewriteReusesCachedTunnelForSameHost(t *testing.T) {
+	cfg := Config{Enabled: true, Addr: "bastion.example.com:22"}
+
+	pool := NewPool()
+	pt := &pooledTunnel{localAddr: "127.0.0.1:12345"}
+	pt.once.Do(func() {})
+	pool.tunnels[cfg.Addr+"->api.example.com:8443"] = pt
+
+	got, err := pool.Rewrite(context.Background(), cfg, "https://api.example.com:8443/path")
+	if err != nil {
+		t.Fatalf("Rewrite() error = %v, want nil", err)
+	}
+	want := "https://127.0.0.1:12345/path"
+	if got != want {
+		t.Fatalf("Rewrite() = %q, want %q (cached tunnel address reused)", got, want)
+	}
+}